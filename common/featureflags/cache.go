@@ -0,0 +1,185 @@
+package featureflags
+
+import (
+	"container/list"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/jonas747/yagpdb/common"
+	"github.com/mediocregopher/radix/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// channelInvalidate is the redis pub/sub channel feature flag cache invalidations are sent on
+const channelInvalidate = "f_flags_invalidate"
+
+// maxCacheEntries bounds the cache size; least recently used guilds are
+// evicted first. Var rather than const so tests can shrink it.
+var maxCacheEntries = 100000
+
+const (
+	// periodicRefreshInterval is how often the whole cache is flushed, as a
+	// fallback for missed invalidation messages. Jittered to spread out the load.
+	periodicRefreshInterval = time.Minute * 10
+	periodicRefreshJitter   = time.Minute * 3
+)
+
+var (
+	metricsCacheSize = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "yagpdb_featureflags_cache_size",
+		Help: "Number of guilds currently cached in the feature flags cache",
+	})
+	metricsCacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "yagpdb_featureflags_cache_hits_total",
+		Help: "Number of feature flag cache hits",
+	})
+	metricsCacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "yagpdb_featureflags_cache_misses_total",
+		Help: "Number of feature flag cache misses",
+	})
+	metricsInvalidationsReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "yagpdb_featureflags_cache_invalidations_total",
+		Help: "Number of feature flag cache invalidations received over pub/sub",
+	})
+)
+
+type cacheEntry struct {
+	guildID   int64
+	flags     []string
+	overrides map[string]bool
+}
+
+var (
+	cache      = make(map[int64]*list.Element)
+	cacheOrder = list.New()
+	cacheL     sync.Mutex
+)
+
+// getCached returns the cached flag set and forced-override map for guildID,
+// fetched together so evaluating rollout flags never needs its own Redis read.
+func getCached(guildID int64) (flags []string, overrides map[string]bool, ok bool) {
+	cacheL.Lock()
+	defer cacheL.Unlock()
+
+	el, ok := cache[guildID]
+	if !ok {
+		metricsCacheMisses.Inc()
+		return nil, nil, false
+	}
+
+	cacheOrder.MoveToFront(el)
+	metricsCacheHits.Inc()
+	entry := el.Value.(*cacheEntry)
+	return entry.flags, entry.overrides, true
+}
+
+func setCached(guildID int64, flags []string, overrides map[string]bool) {
+	cacheL.Lock()
+	defer cacheL.Unlock()
+
+	if el, ok := cache[guildID]; ok {
+		entry := el.Value.(*cacheEntry)
+		entry.flags = flags
+		entry.overrides = overrides
+		cacheOrder.MoveToFront(el)
+		return
+	}
+
+	el := cacheOrder.PushFront(&cacheEntry{guildID: guildID, flags: flags, overrides: overrides})
+	cache[guildID] = el
+
+	for cacheOrder.Len() > maxCacheEntries {
+		oldest := cacheOrder.Back()
+		cacheOrder.Remove(oldest)
+		delete(cache, oldest.Value.(*cacheEntry).guildID)
+	}
+
+	metricsCacheSize.Set(float64(len(cache)))
+}
+
+// publishInvalidateGuild tells every other process to drop its cached flags for guildID
+func publishInvalidateGuild(guildID int64) {
+	err := common.RedisPool.Do(radix.Cmd(nil, "PUBLISH", channelInvalidate, strconv.FormatInt(guildID, 10)))
+	if err != nil {
+		logger.WithError(err).Error("failed publishing feature flags invalidation")
+	}
+}
+
+func invalidateCached(guildID int64) {
+	cacheL.Lock()
+	defer cacheL.Unlock()
+
+	el, ok := cache[guildID]
+	if !ok {
+		return
+	}
+
+	cacheOrder.Remove(el)
+	delete(cache, guildID)
+	metricsCacheSize.Set(float64(len(cache)))
+}
+
+func flushCache() {
+	cacheL.Lock()
+	cache = make(map[int64]*list.Element)
+	cacheOrder = list.New()
+	metricsCacheSize.Set(0)
+	cacheL.Unlock()
+
+	flushRolloutPercentCache()
+}
+
+// Init starts the cache invalidation subscriber and the periodic refresh.
+// Should be called once, on bot startup.
+func Init() {
+	go runInvalidationSubscriber()
+	go runPeriodicRefresh()
+}
+
+func runInvalidationSubscriber() {
+	for {
+		err := subscribeInvalidations()
+		logger.WithError(err).Error("feature flags: invalidation subscriber died, reconnecting")
+		time.Sleep(time.Second * 5)
+	}
+}
+
+func subscribeInvalidations() error {
+	conn, err := common.RedisPool.Get()
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	ps := radix.PubSub(conn)
+	defer ps.Close()
+
+	msgCh := make(chan radix.PubSubMessage)
+	if err := ps.Subscribe(msgCh, channelInvalidate); err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	for msg := range msgCh {
+		guildID, err := strconv.ParseInt(string(msg.Message), 10, 64)
+		if err != nil {
+			logger.WithError(err).Error("feature flags: received malformed invalidation message")
+			continue
+		}
+
+		invalidateCached(guildID)
+		metricsInvalidationsReceived.Inc()
+	}
+
+	return errors.New("feature flags: invalidation pub/sub channel closed")
+}
+
+func runPeriodicRefresh() {
+	for {
+		jitter := time.Duration(rand.Int63n(int64(periodicRefreshJitter)))
+		time.Sleep(periodicRefreshInterval + jitter)
+		flushCache()
+	}
+}
@@ -0,0 +1,53 @@
+package featureflags
+
+import "testing"
+
+func TestSetCachedEvictsLeastRecentlyUsed(t *testing.T) {
+	flushCache()
+	defer flushCache()
+
+	orig := maxCacheEntries
+	maxCacheEntries = 3
+	defer func() { maxCacheEntries = orig }()
+
+	setCached(1, []string{"a"}, nil)
+	setCached(2, []string{"b"}, nil)
+	setCached(3, []string{"c"}, nil)
+
+	if _, _, ok := getCached(1); !ok {
+		t.Fatalf("expected guild 1 to still be cached")
+	}
+
+	setCached(4, []string{"d"}, nil)
+
+	if _, _, ok := getCached(2); ok {
+		t.Fatalf("expected guild 2 to have been evicted as least recently used")
+	}
+
+	if _, _, ok := getCached(1); !ok {
+		t.Fatalf("expected guild 1 to survive eviction, it was touched most recently")
+	}
+
+	if flags, _, ok := getCached(4); !ok || flags[0] != "d" {
+		t.Fatalf("expected guild 4 to be cached with its flags")
+	}
+}
+
+func TestSetCachedUpdatesExistingEntry(t *testing.T) {
+	flushCache()
+	defer flushCache()
+
+	setCached(1, []string{"a"}, nil)
+	setCached(1, []string{"a", "b"}, map[string]bool{"x": true})
+
+	flags, overrides, ok := getCached(1)
+	if !ok {
+		t.Fatalf("expected guild 1 to be cached")
+	}
+	if len(flags) != 2 {
+		t.Fatalf("expected updated flags to be stored, got %v", flags)
+	}
+	if !overrides["x"] {
+		t.Fatalf("expected updated overrides to be stored, got %v", overrides)
+	}
+}
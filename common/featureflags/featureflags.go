@@ -1,6 +1,7 @@
 package featureflags
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
@@ -8,8 +9,11 @@ import (
 	"emperror.dev/errors"
 	"github.com/jonas747/yagpdb/common"
 	"github.com/mediocregopher/radix/v3"
+	"github.com/sirupsen/logrus"
 )
 
+var logger = logrus.WithField("module", "featureflags")
+
 // PluginWithFeatureFlags is a interface for plugins that provide their own feature-flags
 type PluginWithFeatureFlags interface {
 	common.Plugin
@@ -18,47 +22,148 @@ type PluginWithFeatureFlags interface {
 	AllFeatureFlags() []string
 }
 
+// FeatureFlag describes a single flag in the global registry
+type FeatureFlag struct {
+	// Name is the flag identifier, as stored in redis and passed to GuildHasFlag
+	Name string
+
+	// Description is a short human readable explanation shown in admin tooling
+	Description string
+
+	// Plugin is the sysname of the plugin that owns this flag
+	Plugin string
+
+	// Default is returned by GuildHasFlag when the flag isn't in a guild's active set
+	Default bool
+
+	// DeprecatedAt is set once a flag is on its way out
+	DeprecatedAt *time.Time
+}
+
 var (
-	cache  = make(map[int64][]string)
-	cacheL sync.RWMutex
+	registry  = make(map[string]*FeatureFlag)
+	registryL sync.RWMutex
 )
 
+// RegisterFlags adds the provided flags to the global registry
+func RegisterFlags(flags ...*FeatureFlag) {
+	registryL.Lock()
+	defer registryL.Unlock()
+
+	for _, f := range flags {
+		if existing, ok := registry[f.Name]; ok {
+			logger.Errorf("feature flag %q registered twice (owners %q and %q)", f.Name, existing.Plugin, f.Plugin)
+			continue
+		}
+
+		registry[f.Name] = f
+	}
+}
+
+// AllRegisteredFlags returns every flag currently in the registry
+func AllRegisteredFlags() []*FeatureFlag {
+	registryL.RLock()
+	defer registryL.RUnlock()
+
+	flags := make([]*FeatureFlag, 0, len(registry))
+	for _, f := range registry {
+		flags = append(flags, f)
+	}
+
+	return flags
+}
+
+type contextKey int
+
+const contextKeyOverrides contextKey = iota
+
+// ContextWithFlagOverride returns a new context with the given flag forced to
+// value, for tests and admin tooling that need to force a flag on/off for a
+// single request path.
+func ContextWithFlagOverride(ctx context.Context, flag string, value bool) context.Context {
+	existing, _ := ctx.Value(contextKeyOverrides).(map[string]bool)
+
+	overrides := make(map[string]bool, len(existing)+1)
+	for k, v := range existing {
+		overrides[k] = v
+	}
+	overrides[flag] = value
+
+	return context.WithValue(ctx, contextKeyOverrides, overrides)
+}
+
+// FlagFromContext returns the overridden value for flag if one was set via
+// ContextWithFlagOverride, and whether an override was present at all.
+func FlagFromContext(ctx context.Context, flag string) (value bool, ok bool) {
+	overrides, _ := ctx.Value(contextKeyOverrides).(map[string]bool)
+	value, ok = overrides[flag]
+	return value, ok
+}
+
 func keyGuildFlags(guildID int64) string {
 	return fmt.Sprintf("f_flags:%d", guildID)
 }
 
-// GetGuildFlags returns the feature flags a guild has
+// GetGuildFlags returns the feature flags a guild has. Rollout flags are
+// merged in against the cached rollout percent/overrides on every call, so a
+// percent change takes effect on the next read without a cache miss.
 func GetGuildFlags(guildID int64) ([]string, error) {
-	// fast path
-	cacheL.RLock()
-	if flags, ok := cache[guildID]; ok {
-		cacheL.Unlock()
-		return flags, nil
-	}
-	cacheL.RUnlock()
+	base, overrides, ok := getCached(guildID)
+	if !ok {
+		var result []string
+		err := common.RedisPool.Do(radix.Cmd(&result, "SMEMBERS", keyGuildFlags(guildID)))
+		if err != nil {
+			return nil, errors.WithStackIf(err)
+		}
 
-	// need to fetch from redis, upgrade lock
-	cacheL.Lock()
-	defer cacheL.Unlock()
+		overrides, err = loadGuildOverrides(guildID)
+		if err != nil {
+			return nil, err
+		}
 
-	var result []string
-	err := common.RedisPool.Do(radix.Cmd(&result, "SMEMBERS", keyGuildFlags(guildID)))
-	if err != nil {
-		return nil, errors.WithStackIf(err)
+		setCached(guildID, result, overrides)
+		base = result
 	}
 
-	cache[guildID] = result
-	return result, nil
+	return mergeRolloutFlags(guildID, base, overrides)
 }
 
-// GuildHasFlag returns true if the target guild has the provided flag
+// GuildHasFlag returns true if the target guild has the provided flag. An
+// unset flag falls back to its registered default, and an unregistered flag
+// is logged as a likely typo.
 func GuildHasFlag(guildID int64, flag string) (bool, error) {
+	registryL.RLock()
+	ff, registered := registry[flag]
+	registryL.RUnlock()
+
+	if !registered {
+		logger.Errorf("GuildHasFlag called with unregistered flag %q, check for typos", flag)
+	}
+
 	flags, err := GetGuildFlags(guildID)
 	if err != nil {
 		return false, err
 	}
 
-	return common.ContainsStringSlice(flags, flag), nil
+	if common.ContainsStringSlice(flags, flag) {
+		return true, nil
+	}
+
+	if registered {
+		return ff.Default, nil
+	}
+
+	return false, nil
+}
+
+// GuildHasFlagContext is GuildHasFlag, but lets a context override (set via
+// ContextWithFlagOverride) short-circuit the lookup for a single request path.
+func GuildHasFlagContext(ctx context.Context, guildID int64, flag string) (bool, error) {
+	if value, ok := FlagFromContext(ctx, flag); ok {
+		return value, nil
+	}
+
+	return GuildHasFlag(guildID, flag)
 }
 
 // UpdateGuildFlags updates the provided guilds feature flags
@@ -81,6 +186,13 @@ func UpdateGuildFlags(guildID int64) error {
 		}
 	}
 
+	if err := applyRolloutFlags(guildID); err != nil {
+		lastErr = err
+	}
+
+	invalidateCached(guildID)
+	publishInvalidateGuild(guildID)
+
 	return lastErr
 }
 
@@ -138,4 +250,4 @@ func updatePluginFeatureFlags(guildID int64, p PluginWithFeatureFlags) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
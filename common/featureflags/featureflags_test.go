@@ -0,0 +1,75 @@
+package featureflags
+
+import (
+	"context"
+	"testing"
+)
+
+func resetRegistry() {
+	registryL.Lock()
+	registry = make(map[string]*FeatureFlag)
+	registryL.Unlock()
+}
+
+func TestRegisterFlagsAndAllRegisteredFlags(t *testing.T) {
+	resetRegistry()
+	defer resetRegistry()
+
+	RegisterFlags(&FeatureFlag{Name: "flag_a", Plugin: "plugin_a", Default: true})
+	RegisterFlags(&FeatureFlag{Name: "flag_b", Plugin: "plugin_b"})
+
+	all := AllRegisteredFlags()
+	if len(all) != 2 {
+		t.Fatalf("expected 2 registered flags, got %d", len(all))
+	}
+
+	byName := make(map[string]*FeatureFlag, len(all))
+	for _, f := range all {
+		byName[f.Name] = f
+	}
+
+	if byName["flag_a"] == nil || !byName["flag_a"].Default {
+		t.Fatalf("expected flag_a to be registered with Default=true")
+	}
+	if byName["flag_b"] == nil || byName["flag_b"].Plugin != "plugin_b" {
+		t.Fatalf("expected flag_b to be registered under plugin_b")
+	}
+}
+
+func TestRegisterFlagsRejectsDuplicates(t *testing.T) {
+	resetRegistry()
+	defer resetRegistry()
+
+	RegisterFlags(&FeatureFlag{Name: "dup_flag", Plugin: "first_owner", Default: true})
+	RegisterFlags(&FeatureFlag{Name: "dup_flag", Plugin: "second_owner", Default: false})
+
+	all := AllRegisteredFlags()
+	if len(all) != 1 {
+		t.Fatalf("expected the duplicate registration to be dropped, got %d flags", len(all))
+	}
+	if all[0].Plugin != "first_owner" {
+		t.Fatalf("expected the first registration to win, got owner %q", all[0].Plugin)
+	}
+}
+
+func TestContextWithFlagOverride(t *testing.T) {
+	ctx := context.Background()
+
+	if _, ok := FlagFromContext(ctx, "some_flag"); ok {
+		t.Fatalf("expected no override on a bare context")
+	}
+
+	ctx = ContextWithFlagOverride(ctx, "some_flag", true)
+	value, ok := FlagFromContext(ctx, "some_flag")
+	if !ok || !value {
+		t.Fatalf("expected some_flag to be overridden to true")
+	}
+
+	ctx = ContextWithFlagOverride(ctx, "other_flag", false)
+	if value, ok := FlagFromContext(ctx, "some_flag"); !ok || !value {
+		t.Fatalf("expected the earlier override to survive a second override call")
+	}
+	if value, ok := FlagFromContext(ctx, "other_flag"); !ok || value {
+		t.Fatalf("expected other_flag to be overridden to false")
+	}
+}
@@ -0,0 +1,351 @@
+package featureflags
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+
+	"emperror.dev/errors"
+	"github.com/jonas747/yagpdb/common"
+	"github.com/mediocregopher/radix/v3"
+)
+
+// RolloutFlag is a flag enabled for a deterministic fraction of guilds,
+// rather than being computed per-guild by a plugin. Percent only appears in
+// the flag's registry description: registration does not write it to redis,
+// so the flag is at 0% until SetRolloutPercent is called for it.
+type RolloutFlag struct {
+	Name    string
+	Percent int
+}
+
+const keyRolloutPercentages = "f_flags:rollout"
+
+func keyGuildOverrides(guildID int64) string {
+	return fmt.Sprintf("f_flags:override:%d", guildID)
+}
+
+var (
+	rolloutFlagNames []string
+	rolloutL         sync.RWMutex
+
+	rolloutPercentCache  = make(map[string]int)
+	rolloutPercentCached bool
+	rolloutPercentL      sync.RWMutex
+)
+
+// RegisterRolloutFlags adds flags to the set of rollout flags evaluated for
+// every guild, and registers each into the shared registry so it shows up in
+// AllRegisteredFlags and GuildHasFlag stops treating it as unknown.
+func RegisterRolloutFlags(flags ...*RolloutFlag) {
+	rolloutL.Lock()
+	for _, f := range flags {
+		rolloutFlagNames = append(rolloutFlagNames, f.Name)
+	}
+	rolloutL.Unlock()
+
+	for _, f := range flags {
+		RegisterFlags(&FeatureFlag{
+			Name:        f.Name,
+			Description: fmt.Sprintf("rollout flag, starting at %d%%", f.Percent),
+			Plugin:      "rollout",
+			Default:     false,
+		})
+	}
+}
+
+// SetRolloutPercent sets what percentage of guilds should have flag enabled.
+// Rollout membership is evaluated live by GetGuildFlags, so in this process
+// it takes effect on the very next read for every guild without recomputing
+// anything. No invalidation is published: other processes keep their cached
+// percent until their periodic refresh flushes it.
+func SetRolloutPercent(flag string, pct int) error {
+	if pct < 0 || pct > 100 {
+		return errors.NewPlain("rollout percent must be between 0 and 100")
+	}
+
+	err := common.RedisPool.Do(radix.Cmd(nil, "HSET", keyRolloutPercentages, flag, strconv.Itoa(pct)))
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	rolloutPercentL.Lock()
+	if rolloutPercentCached {
+		rolloutPercentCache[flag] = pct
+	}
+	rolloutPercentL.Unlock()
+
+	return nil
+}
+
+func getRolloutPercent(flag string) (int, error) {
+	var raw string
+	err := common.RedisPool.Do(radix.Cmd(&raw, "HGET", keyRolloutPercentages, flag))
+	if err != nil {
+		return 0, errors.WithStackIf(err)
+	}
+
+	if raw == "" {
+		return 0, nil
+	}
+
+	pct, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, errors.WithStackIf(err)
+	}
+
+	return pct, nil
+}
+
+// cachedRolloutPercent returns flag's rollout percent from an in-process
+// cache loaded with a single HGETALL, instead of one HGET per flag on every
+// guild flag read. SetRolloutPercent keeps it fresh on write; flushCache
+// (the periodic refresh fallback) drops it so other processes pick up
+// percent changes made elsewhere within periodicRefreshInterval plus up to
+// periodicRefreshJitter.
+func cachedRolloutPercent(flag string) (int, error) {
+	rolloutPercentL.RLock()
+	if rolloutPercentCached {
+		pct := rolloutPercentCache[flag]
+		rolloutPercentL.RUnlock()
+		return pct, nil
+	}
+	rolloutPercentL.RUnlock()
+
+	rolloutPercentL.Lock()
+	defer rolloutPercentL.Unlock()
+
+	if rolloutPercentCached {
+		return rolloutPercentCache[flag], nil
+	}
+
+	var raw map[string]string
+	err := common.RedisPool.Do(radix.Cmd(&raw, "HGETALL", keyRolloutPercentages))
+	if err != nil {
+		return 0, errors.WithStackIf(err)
+	}
+
+	percents := make(map[string]int, len(raw))
+	for name, val := range raw {
+		pct, err := strconv.Atoi(val)
+		if err != nil {
+			return 0, errors.WithStackIf(err)
+		}
+		percents[name] = pct
+	}
+
+	rolloutPercentCache = percents
+	rolloutPercentCached = true
+
+	return rolloutPercentCache[flag], nil
+}
+
+// flushRolloutPercentCache drops the in-process rollout percent cache,
+// forcing the next read to reload it from redis.
+func flushRolloutPercentCache() {
+	rolloutPercentL.Lock()
+	defer rolloutPercentL.Unlock()
+
+	rolloutPercentCached = false
+}
+
+// ForceGuildFlag pins flag on or off for guildID, regardless of its rollout bucket
+func ForceGuildFlag(guildID int64, flag string, state bool) error {
+	val := "0"
+	if state {
+		val = "1"
+	}
+
+	err := common.RedisPool.Do(radix.Cmd(nil, "HSET", keyGuildOverrides(guildID), flag, val))
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	invalidateCached(guildID)
+	publishInvalidateGuild(guildID)
+
+	return nil
+}
+
+// ClearGuildFlagOverride removes a previously forced flag for guildID
+func ClearGuildFlagOverride(guildID int64, flag string) error {
+	err := common.RedisPool.Do(radix.Cmd(nil, "HDEL", keyGuildOverrides(guildID), flag))
+	if err != nil {
+		return errors.WithStackIf(err)
+	}
+
+	invalidateCached(guildID)
+	publishInvalidateGuild(guildID)
+
+	return nil
+}
+
+// GuildForcedFlag returns whether flag has been forced for guildID via
+// ForceGuildFlag, and if so what state it was forced to.
+func GuildForcedFlag(guildID int64, flag string) (state bool, forced bool, err error) {
+	return guildForcedFlag(guildID, flag)
+}
+
+func guildForcedFlag(guildID int64, flag string) (state bool, forced bool, err error) {
+	var raw string
+	err = common.RedisPool.Do(radix.Cmd(&raw, "HGET", keyGuildOverrides(guildID), flag))
+	if err != nil {
+		return false, false, errors.WithStackIf(err)
+	}
+
+	if raw == "" {
+		return false, false, nil
+	}
+
+	return raw == "1", true, nil
+}
+
+// loadGuildOverrides fetches every flag forced for guildID in a single
+// HGETALL, so evaluating a guild's rollout flags needs no per-flag Redis read.
+func loadGuildOverrides(guildID int64) (map[string]bool, error) {
+	var raw map[string]string
+	err := common.RedisPool.Do(radix.Cmd(&raw, "HGETALL", keyGuildOverrides(guildID)))
+	if err != nil {
+		return nil, errors.WithStackIf(err)
+	}
+
+	overrides := make(map[string]bool, len(raw))
+	for flag, val := range raw {
+		overrides[flag] = val == "1"
+	}
+
+	return overrides, nil
+}
+
+// IsRolloutFlag returns whether flag was registered via RegisterRolloutFlags
+func IsRolloutFlag(flag string) bool {
+	rolloutL.RLock()
+	defer rolloutL.RUnlock()
+
+	return common.ContainsStringSlice(rolloutFlagNames, flag)
+}
+
+// guildInRollout deterministically decides whether guildID falls in the
+// enabled bucket for flag at the given percent, using a stable hash (fnv-64)
+// so a guild doesn't flicker in and out of the bucket as the percent moves.
+func guildInRollout(flag string, guildID int64, percent int) bool {
+	if percent <= 0 {
+		return false
+	}
+	if percent >= 100 {
+		return true
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(flag))
+	h.Write([]byte(":"))
+	h.Write([]byte(strconv.FormatInt(guildID, 10)))
+
+	return h.Sum64()%100 < uint64(percent)
+}
+
+func evaluateRolloutFlag(guildID int64, flag string) (bool, error) {
+	state, forced, err := guildForcedFlag(guildID, flag)
+	if err != nil {
+		return false, err
+	}
+	if forced {
+		return state, nil
+	}
+
+	pct, err := getRolloutPercent(flag)
+	if err != nil {
+		return false, err
+	}
+
+	return guildInRollout(flag, guildID, pct), nil
+}
+
+// evaluateRolloutFlagCached is evaluateRolloutFlag's hot-path counterpart: it
+// takes overrides already fetched alongside the guild's cached flags and
+// reads the rollout percent from the in-process cache, so a GetGuildFlags
+// call makes zero additional Redis round-trips per rollout flag.
+func evaluateRolloutFlagCached(guildID int64, flag string, overrides map[string]bool) (bool, error) {
+	if state, forced := overrides[flag]; forced {
+		return state, nil
+	}
+
+	pct, err := cachedRolloutPercent(flag)
+	if err != nil {
+		return false, err
+	}
+
+	return guildInRollout(flag, guildID, pct), nil
+}
+
+func registeredRolloutFlags() []string {
+	rolloutL.RLock()
+	defer rolloutL.RUnlock()
+
+	names := make([]string, len(rolloutFlagNames))
+	copy(names, rolloutFlagNames)
+	return names
+}
+
+// applyRolloutFlags evaluates every registered rollout flag for guildID and
+// adds/removes it from the guild's flag set accordingly.
+func applyRolloutFlags(guildID int64) error {
+	names := registeredRolloutFlags()
+	if len(names) == 0 {
+		return nil
+	}
+
+	key := keyGuildFlags(guildID)
+
+	var lastErr error
+	for _, name := range names {
+		enabled, err := evaluateRolloutFlag(guildID, name)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		cmd := "SREM"
+		if enabled {
+			cmd = "SADD"
+		}
+
+		if err := common.RedisPool.Do(radix.Cmd(nil, cmd, key, name)); err != nil {
+			lastErr = errors.WithStackIf(err)
+		}
+	}
+
+	return lastErr
+}
+
+// mergeRolloutFlags replaces any rollout flag entries in base with an
+// evaluation against the cached rollout percent and the guild's overrides
+// (fetched alongside base), so a percent change is reflected on the next
+// read without making any Redis calls of its own on a cache hit.
+func mergeRolloutFlags(guildID int64, base []string, overrides map[string]bool) ([]string, error) {
+	names := registeredRolloutFlags()
+	if len(names) == 0 {
+		return base, nil
+	}
+
+	out := make([]string, 0, len(base)+len(names))
+	for _, f := range base {
+		if !common.ContainsStringSlice(names, f) {
+			out = append(out, f)
+		}
+	}
+
+	for _, name := range names {
+		enabled, err := evaluateRolloutFlagCached(guildID, name, overrides)
+		if err != nil {
+			return nil, err
+		}
+
+		if enabled {
+			out = append(out, name)
+		}
+	}
+
+	return out, nil
+}
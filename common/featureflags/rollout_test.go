@@ -0,0 +1,39 @@
+package featureflags
+
+import "testing"
+
+func TestGuildInRolloutBounds(t *testing.T) {
+	if guildInRollout("some_flag", 1, 0) {
+		t.Fatalf("expected 0%% rollout to never be in bucket")
+	}
+
+	if !guildInRollout("some_flag", 1, 100) {
+		t.Fatalf("expected 100%% rollout to always be in bucket")
+	}
+}
+
+func TestGuildInRolloutDeterministic(t *testing.T) {
+	first := guildInRollout("some_flag", 42, 50)
+	for i := 0; i < 10; i++ {
+		if guildInRollout("some_flag", 42, 50) != first {
+			t.Fatalf("expected guildInRollout to be deterministic for the same flag/guild/percent")
+		}
+	}
+}
+
+func TestGuildInRolloutDistribution(t *testing.T) {
+	const numGuilds = 10000
+	const percent = 30
+
+	var inBucket int
+	for guildID := int64(0); guildID < numGuilds; guildID++ {
+		if guildInRollout("distribution_flag", guildID, percent) {
+			inBucket++
+		}
+	}
+
+	gotPercent := float64(inBucket) / float64(numGuilds) * 100
+	if gotPercent < percent-5 || gotPercent > percent+5 {
+		t.Fatalf("expected roughly %d%% of guilds in bucket, got %.1f%%", percent, gotPercent)
+	}
+}
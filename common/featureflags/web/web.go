@@ -0,0 +1,209 @@
+// Package web mounts admin-only HTTP routes for the feature flag catalog,
+// per-guild flag state, on-demand recompute, and manual overrides.
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"emperror.dev/errors"
+	"github.com/gorilla/mux"
+	"github.com/jonas747/yagpdb/common"
+	"github.com/jonas747/yagpdb/common/featureflags"
+	"github.com/sirupsen/logrus"
+)
+
+var logger = logrus.WithField("module", "featureflags/web")
+
+// AdminAuthMiddleware gates every route mounted by InitWeb; must be set
+// (to the main web package's bot admin auth) before InitWeb is called.
+var AdminAuthMiddleware mux.MiddlewareFunc
+
+// ActorFromRequest returns the user ID making the request, for the audit log
+var ActorFromRequest func(r *http.Request) int64
+
+// InitWeb mounts the feature flag admin routes onto muxer under "/admin/featureflags"
+func InitWeb(muxer *mux.Router) {
+	if AdminAuthMiddleware == nil || ActorFromRequest == nil {
+		panic("featureflags/web: InitWeb called before AdminAuthMiddleware/ActorFromRequest were set")
+	}
+
+	sub := muxer.PathPrefix("/admin/featureflags").Subrouter()
+	sub.Use(AdminAuthMiddleware)
+
+	sub.HandleFunc("", handleListFlags).Methods(http.MethodGet)
+	sub.HandleFunc("/guild/{guild:[0-9]+}", handleGuildFlags).Methods(http.MethodGet)
+	sub.HandleFunc("/guild/{guild:[0-9]+}/update", handleUpdateGuild).Methods(http.MethodPost)
+	sub.HandleFunc("/guild/{guild:[0-9]+}/override", handleSetOverride).Methods(http.MethodPost)
+}
+
+type flagCatalogEntry struct {
+	Name        string `json:"name"`
+	Plugin      string `json:"plugin"`
+	Description string `json:"description"`
+	Default     bool   `json:"default"`
+	Deprecated  bool   `json:"deprecated"`
+}
+
+func handleListFlags(w http.ResponseWriter, r *http.Request) {
+	registered := featureflags.AllRegisteredFlags()
+
+	out := make([]*flagCatalogEntry, 0, len(registered))
+	for _, f := range registered {
+		out = append(out, &flagCatalogEntry{
+			Name:        f.Name,
+			Plugin:      f.Plugin,
+			Description: f.Description,
+			Default:     f.Default,
+			Deprecated:  f.DeprecatedAt != nil,
+		})
+	}
+
+	writeJSON(w, out)
+}
+
+// flagSourceType describes where an active flag's value for a guild came from
+type flagSourceType string
+
+const (
+	flagSourceComputed flagSourceType = "computed"
+	flagSourceOverride flagSourceType = "override"
+	flagSourceRollout  flagSourceType = "rollout"
+)
+
+type guildFlagEntry struct {
+	Name   string         `json:"name"`
+	Active bool           `json:"active"`
+	Source flagSourceType `json:"source"`
+}
+
+func handleGuildFlags(w http.ResponseWriter, r *http.Request) {
+	guildID, err := parseGuildID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	active, err := featureflags.GetGuildFlags(guildID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	out := make([]*guildFlagEntry, 0, len(active))
+	for _, name := range active {
+		out = append(out, &guildFlagEntry{Name: name, Active: true, Source: flagSource(name, guildID)})
+	}
+
+	writeJSON(w, out)
+}
+
+// flagSource reports where an active flag's value for guildID came from:
+// a manual override, live rollout evaluation, or a plugin-computed default.
+func flagSource(name string, guildID int64) flagSourceType {
+	if _, forced, err := featureflags.GuildForcedFlag(guildID, name); err == nil && forced {
+		return flagSourceOverride
+	}
+
+	if featureflags.IsRolloutFlag(name) {
+		return flagSourceRollout
+	}
+
+	return flagSourceComputed
+}
+
+func handleUpdateGuild(w http.ResponseWriter, r *http.Request) {
+	guildID, err := parseGuildID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := featureflags.UpdateGuildFlags(guildID); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	auditLog(r, guildID, "", "", "recomputed")
+	writeJSON(w, map[string]bool{"ok": true})
+}
+
+type setOverrideBody struct {
+	Flag  string `json:"flag"`
+	State bool   `json:"state"`
+}
+
+func handleSetOverride(w http.ResponseWriter, r *http.Request) {
+	guildID, err := parseGuildID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var body setOverrideBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, errors.WithStackIf(err))
+		return
+	}
+
+	if !featureflags.IsRolloutFlag(body.Flag) {
+		writeError(w, http.StatusBadRequest, errors.NewPlain("flag is not a rollout flag, overrides only apply to those"))
+		return
+	}
+
+	before, err := featureflags.GetGuildFlags(guildID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := featureflags.ForceGuildFlag(guildID, body.Flag, body.State); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	beforeState := common.ContainsStringSlice(before, body.Flag)
+	auditLog(r, guildID, body.Flag, boolLabel(beforeState), boolLabel(body.State))
+
+	writeJSON(w, map[string]bool{"ok": true})
+}
+
+func auditLog(r *http.Request, guildID int64, flag, before, after string) {
+	logger.WithFields(logrus.Fields{
+		"actor":    ActorFromRequest(r),
+		"guild":    guildID,
+		"flag":     flag,
+		"before":   before,
+		"after":    after,
+		"audit":    true,
+		"resource": "featureflags",
+	}).Info("feature flags admin action")
+}
+
+func boolLabel(v bool) string {
+	if v {
+		return "on"
+	}
+	return "off"
+}
+
+func parseGuildID(r *http.Request) (int64, error) {
+	return strconv.ParseInt(mux.Vars(r)["guild"], 10, 64)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.WithError(err).Error("failed writing feature flags admin response")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	logger.WithError(err).Error("feature flags admin request failed")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if encErr := json.NewEncoder(w).Encode(map[string]string{"error": err.Error()}); encErr != nil {
+		logger.WithError(encErr).Error("failed writing feature flags admin response")
+	}
+}
@@ -0,0 +1,76 @@
+package web
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestParseGuildID(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = mux.SetURLVars(r, map[string]string{"guild": "123"})
+
+	guildID, err := parseGuildID(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if guildID != 123 {
+		t.Fatalf("expected guildID 123, got %d", guildID)
+	}
+
+	r = mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/", nil), map[string]string{"guild": "not-a-number"})
+	if _, err := parseGuildID(r); err == nil {
+		t.Fatalf("expected an error for a non-numeric guild id")
+	}
+}
+
+func TestBoolLabel(t *testing.T) {
+	if boolLabel(true) != "on" {
+		t.Fatalf(`expected "on" for true`)
+	}
+	if boolLabel(false) != "off" {
+		t.Fatalf(`expected "off" for false`)
+	}
+}
+
+func TestInitWebPanicsWithoutSeams(t *testing.T) {
+	origAuth, origActor := AdminAuthMiddleware, ActorFromRequest
+	defer func() { AdminAuthMiddleware, ActorFromRequest = origAuth, origActor }()
+
+	AdminAuthMiddleware, ActorFromRequest = nil, nil
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected InitWeb to panic when seam vars aren't set")
+		}
+	}()
+
+	InitWeb(mux.NewRouter())
+}
+
+func TestHandleSetOverrideRejectsMalformedBody(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("not json"))
+	r = mux.SetURLVars(r, map[string]string{"guild": "123"})
+	w := httptest.NewRecorder()
+
+	handleSetOverride(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for a malformed body, got %d", w.Code)
+	}
+}
+
+func TestHandleSetOverrideRejectsNonRolloutFlag(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"flag":"not_a_rollout_flag","state":true}`))
+	r = mux.SetURLVars(r, map[string]string{"guild": "123"})
+	w := httptest.NewRecorder()
+
+	handleSetOverride(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for a non-rollout flag, got %d", w.Code)
+	}
+}